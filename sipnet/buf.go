@@ -0,0 +1,101 @@
+package sipnet
+
+import (
+	"net"
+	"sync"
+)
+
+// pipeAddr is the net.Addr reported by a pipeListener and the Conns it
+// produces; there is no real network address to report.
+type pipeAddr string
+
+func (a pipeAddr) Network() string { return "pipe" }
+func (a pipeAddr) String() string  { return string(a) }
+
+// pipeListener is an in-memory net.Listener backed by net.Pipe() connection
+// pairs, in the style of grpc's bufconn. It has no underlying socket, so
+// Accept only ever produces connections created by calling dial on it.
+type pipeListener struct {
+	accept chan net.Conn
+	closed chan struct{}
+	once   sync.Once
+}
+
+func newPipeListener() *pipeListener {
+	return &pipeListener{
+		accept: make(chan net.Conn),
+		closed: make(chan struct{}),
+	}
+}
+
+func (p *pipeListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-p.accept:
+		return conn, nil
+	case <-p.closed:
+		return nil, ErrClosed
+	}
+}
+
+func (p *pipeListener) Close() error {
+	p.once.Do(func() { close(p.closed) })
+	return nil
+}
+
+func (p *pipeListener) Addr() net.Addr {
+	return pipeAddr("pipe")
+}
+
+// dial creates an in-memory connection pair and hands the server side to a
+// pending or future Accept, returning the client side to the caller.
+func (p *pipeListener) dial() (net.Conn, error) {
+	client, server := net.Pipe()
+
+	select {
+	case p.accept <- server:
+		return client, nil
+	case <-p.closed:
+		client.Close()
+		server.Close()
+		return nil, ErrClosed
+	}
+}
+
+// BufListen returns a Listener backed by in-process net.Pipe connections
+// rather than real TCP/UDP sockets, mirroring the grpc bufconn pattern: it
+// exposes the same AcceptRequest/AcceptTransaction/Close/Addr surface as
+// Listen, so handlers can be unit tested with the returned Listener's Dial
+// method instead of binding real ports or racing on ephemeral addresses. sz
+// is accepted for parity with bufconn.Listen but is unused: the pipes are
+// unbuffered, so a write on either end (including Conn.WriteResponse)
+// blocks until the other end reads it.
+func BufListen(sz int) *Listener {
+	listener := newListener()
+	listener.tcpListener = newPipeListener()
+
+	go handleTCPListening(listener)
+
+	return listener
+}
+
+// Dial connects a new in-memory net.Conn to a Listener created with
+// BufListen, delivering its server side to a pending or future
+// AcceptRequest/AcceptTransaction. It returns a plain net.Conn rather than
+// a *Conn: *Conn is the server-side handle for writing responses back to a
+// peer the Listener is already reading from, and has no Read method, so it
+// can't serve as the client end of the pipe, which needs to write a
+// request and read the response back itself. It panics if l was not
+// created with BufListen, since dialing a real socket-backed Listener this
+// way wouldn't make sense.
+func (l *Listener) Dial() net.Conn {
+	pl, ok := l.tcpListener.(*pipeListener)
+	if !ok {
+		panic("sip: Dial called on a Listener not created with BufListen")
+	}
+
+	conn, err := pl.dial()
+	if err != nil {
+		panic(err)
+	}
+	return conn
+}
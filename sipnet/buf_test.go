@@ -0,0 +1,48 @@
+package sipnet
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+)
+
+// TestBufListenDialRoundTrip exercises the in-memory path end to end: Dial
+// writes a request into a Listener created with BufListen, AcceptRequest
+// hands it back on the server side, and the response written through the
+// returned Conn reaches the client.
+func TestBufListenDialRoundTrip(t *testing.T) {
+	listener := BufListen(0)
+	defer listener.Close()
+
+	conn := listener.Dial()
+	defer conn.Close()
+
+	const req = "INVITE sip:bob@example.com SIP/2.0\r\n" +
+		"Via: SIP/2.0/TCP pc33.example.com;branch=z9hG4bK776asdhds\r\n" +
+		"Content-Length: 0\r\n" +
+		"\r\n"
+
+	if _, err := conn.Write([]byte(req)); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	gotReq, gotConn, err := listener.AcceptRequest()
+	if err != nil {
+		t.Fatalf("AcceptRequest: %v", err)
+	}
+	if gotReq.Method != "INVITE" {
+		t.Fatalf("Method = %q, want INVITE", gotReq.Method)
+	}
+
+	if err := gotConn.WriteResponse(NewResponse(gotReq, 200, "OK")); err != nil {
+		t.Fatalf("WriteResponse: %v", err)
+	}
+
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		t.Fatalf("ReadString: %v", err)
+	}
+	if !strings.HasPrefix(line, "SIP/2.0 200 OK") {
+		t.Fatalf("response line = %q, want SIP/2.0 200 OK", line)
+	}
+}
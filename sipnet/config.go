@@ -0,0 +1,155 @@
+package sipnet
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ListenEntry configures a single transport within a ListenConfig.
+type ListenEntry struct {
+	// Transport is one of "udp", "tcp", "tls", or "ws" (case-insensitive).
+	Transport string `yaml:"transport" json:"transport"`
+	// Addr is the bind address, e.g. "0.0.0.0:5060".
+	Addr string `yaml:"addr" json:"addr"`
+
+	// CertFile and KeyFile are required when Transport is "tls".
+	CertFile string `yaml:"certFile,omitempty" json:"certFile,omitempty"`
+	KeyFile  string `yaml:"keyFile,omitempty" json:"keyFile,omitempty"`
+
+	// ProxyProtocol accepts a leading PROXY protocol v2 header (as sent by
+	// HAProxy and similar) on each connection, so RemoteAddr reflects the
+	// original client rather than the load balancer. Not supported on udp
+	// entries, since PROXY protocol is connection-oriented; Listen rejects
+	// a udp entry with ProxyProtocol set.
+	ProxyProtocol bool `yaml:"proxyProtocol,omitempty" json:"proxyProtocol,omitempty"`
+
+	// MaxMessageSize caps the size of message this listener will accept, in
+	// bytes: the declared Content-Length on stream transports, the whole
+	// datagram on udp. Zero means unlimited.
+	MaxMessageSize int `yaml:"maxMessageSize,omitempty" json:"maxMessageSize,omitempty"`
+
+	// Tag is attached to every Conn accepted on this entry (see Conn.Tag),
+	// so a handler serving several entries can tell them apart.
+	Tag string `yaml:"tag,omitempty" json:"tag,omitempty"`
+}
+
+// ListenConfig describes a set of listener entries that should be fanned
+// into a single Listener's AcceptRequest/AcceptTransaction channel, letting
+// operators run e.g. SIPS on 5061, plain SIP on 5060, and WSS on 443 behind
+// a PROXY-protocol load balancer as one process.
+//
+// At most one entry per Transport is supported: Tag, ProxyProtocol, and
+// MaxMessageSize are keyed by transport kind, but the underlying
+// ListenTCP/ListenUDP/ListenTLS/ListenWS each hold a single listener and
+// reject a second call for the same transport. Binding two addresses on
+// the same transport requires two separate Listeners.
+type ListenConfig struct {
+	Listeners []ListenEntry `yaml:"listeners" json:"listeners"`
+}
+
+// LoadListenConfigYAML reads and parses a ListenConfig from a YAML file at
+// path.
+func LoadListenConfigYAML(path string) (*ListenConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg ListenConfig
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// LoadListenConfigJSON reads and parses a ListenConfig from a JSON file at
+// path.
+func LoadListenConfigJSON(path string) (*ListenConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg ListenConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// Listen starts every listener described by cfg and returns the resulting
+// composite Listener. If any entry fails to start, listeners already
+// started are closed and the first error is returned.
+func (cfg *ListenConfig) Listen() (*Listener, error) {
+	l := newListener()
+
+	for _, entry := range cfg.Listeners {
+		if err := l.startEntry(entry); err != nil {
+			l.Close()
+			return nil, err
+		}
+	}
+
+	return l, nil
+}
+
+func (l *Listener) startEntry(entry ListenEntry) error {
+	kind, err := parseTransportKind(entry.Transport)
+	if err != nil {
+		return err
+	}
+
+	if entry.ProxyProtocol && kind == transportUDP {
+		// PROXY protocol v2 over UDP prepends a header to each datagram
+		// rather than once per connection, which nothing on the UDP read
+		// path strips; reject it outright rather than silently ignoring it.
+		return fmt.Errorf("sip: PROXY protocol is not supported on udp listeners (%s)", entry.Addr)
+	}
+
+	if entry.Tag != "" {
+		l.tags[kind] = entry.Tag
+	}
+	if entry.ProxyProtocol {
+		l.proxyProtocol[kind] = true
+	}
+	if entry.MaxMessageSize > 0 {
+		l.maxMessageSize[kind] = entry.MaxMessageSize
+	}
+
+	switch kind {
+	case transportUDP:
+		return l.ListenUDP(entry.Addr)
+	case transportTCP:
+		return l.ListenTCP(entry.Addr)
+	case transportTLS:
+		cert, err := tls.LoadX509KeyPair(entry.CertFile, entry.KeyFile)
+		if err != nil {
+			return err
+		}
+		return l.ListenTLS(entry.Addr, cert)
+	case transportWS:
+		return l.ListenWS(entry.Addr)
+	default:
+		return fmt.Errorf("sip: unknown listener transport %q", entry.Transport)
+	}
+}
+
+func parseTransportKind(transport string) (transportKind, error) {
+	switch strings.ToLower(transport) {
+	case "udp":
+		return transportUDP, nil
+	case "tcp":
+		return transportTCP, nil
+	case "tls":
+		return transportTLS, nil
+	case "ws":
+		return transportWS, nil
+	default:
+		return "", fmt.Errorf("sip: unknown listener transport %q", transport)
+	}
+}
@@ -0,0 +1,231 @@
+package sipnet
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/kascad/go-sip/sipnet/transaction"
+)
+
+// transportKind identifies which network mechanism a Conn arrived over, as
+// reported by Conn.Transport. Nothing in sipnet rewrites a Via's transport
+// or a Contact header from it.
+type transportKind string
+
+const (
+	transportUDP transportKind = "UDP"
+	transportTCP transportKind = "TCP"
+	transportTLS transportKind = "TLS"
+	transportWS  transportKind = "WS"
+)
+
+// Conn represents a single logical peer a SIP request was received from and
+// responses are written to. For stream transports (TCP, TLS, WS) this wraps
+// one net.Conn; for UDP, which has no per-peer connection, it wraps the
+// listener's shared socket plus the peer's address.
+type Conn struct {
+	listener  *Listener
+	transport transportKind
+
+	raw    net.Conn // nil for UDP
+	remote net.Addr
+	tag    string
+
+	writeMu sync.Mutex
+
+	// txn is the server transaction currently owning this Conn's requests,
+	// if the Listener was driven via AcceptTransaction. WriteResponse routes
+	// through it so retransmission and ACK absorption happen automatically.
+	txn *transaction.ServerTransaction
+}
+
+// Transport reports which transport ("UDP", "TCP", "TLS", or "WS") this Conn
+// was accepted on.
+func (c *Conn) Transport() string {
+	return string(c.transport)
+}
+
+// RemoteAddr returns the address of the peer this Conn communicates with.
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+// Tag returns the tag configured for the listener entry this Conn was
+// accepted on (see ListenEntry.Tag), or "" if it wasn't started from a
+// ListenConfig or no tag was set.
+func (c *Conn) Tag() string {
+	return c.tag
+}
+
+// WriteResponse serializes resp and writes it back to the peer over the
+// transport this Conn was accepted on. If this Conn's request was accepted
+// via AcceptTransaction, the write is routed through the owning transaction
+// so retransmission (for unreliable transports) and final-response
+// bookkeeping happen automatically.
+func (c *Conn) WriteResponse(resp *Response) error {
+	data := marshalResponse(resp)
+
+	if c.txn != nil {
+		if resp.StatusCode < 200 {
+			return c.txn.SendProvisional(data)
+		}
+		return c.txn.SendFinal(data, resp.StatusCode)
+	}
+
+	return c.WriteRaw(data)
+}
+
+// WriteRaw writes an already-serialized message to the peer. It satisfies
+// transaction.Responder so a Conn can back a transaction directly.
+func (c *Conn) WriteRaw(data []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if c.transport == transportUDP {
+		_, err := c.listener.udpListener.WriteTo(data, c.remote)
+		return err
+	}
+
+	_, err := c.raw.Write(data)
+	return err
+}
+
+// Close closes the underlying connection. It is a no-op for UDP Conns,
+// which share the listener's socket.
+func (c *Conn) Close() error {
+	if c.raw == nil {
+		return nil
+	}
+	return c.raw.Close()
+}
+
+// registerTCPConn wraps a freshly accepted plain TCP (or BufListen pipe)
+// connection in a Conn and starts reading framed SIP requests off of it until it is
+// closed or a read error occurs.
+func (l *Listener) registerTCPConn(conn net.Conn) {
+	l.registerStreamConn(conn, transportTCP)
+}
+
+// registerStreamConn is like registerTCPConn but lets the caller specify the
+// transport kind, so TLS and WebSocket listeners can reuse the same framing
+// loop while still tagging Conn with where the request actually came from.
+func (l *Listener) registerStreamConn(conn net.Conn, kind transportKind) {
+	// TLS strips its own PROXY header, before the handshake, in
+	// tlsListener.Accept; doing it again here would read the TLS
+	// handshake's bytes as a PROXY header and fail.
+	if kind != transportTLS && l.proxyProtocol[kind] {
+		wrapped, err := readProxyProtocolV2(conn)
+		if err != nil {
+			conn.Close()
+			return
+		}
+		conn = wrapped
+	}
+
+	c := &Conn{listener: l, transport: kind, raw: conn, remote: conn.RemoteAddr(), tag: l.tags[kind]}
+
+	l.connWG.Add(1)
+	go func() {
+		defer l.connWG.Done()
+		defer conn.Close()
+
+		reader := bufio.NewReader(conn)
+		for {
+			if l.idleTimeout > 0 {
+				conn.SetReadDeadline(time.Now().Add(l.idleTimeout))
+			}
+
+			raw, err := readFramedMessage(reader, l.maxMessageSize[kind])
+			if err != nil {
+				if ne, ok := err.(net.Error); ok && ne.Timeout() {
+					return
+				}
+				if err != io.EOF {
+					l.requestChannel <- requestPackage{conn: c, err: err}
+				}
+				return
+			}
+
+			req, err := parseRequest(raw)
+			if err != nil {
+				l.requestChannel <- requestPackage{conn: c, err: err}
+				continue
+			}
+
+			l.requestChannel <- requestPackage{conn: c, req: req}
+		}
+	}()
+}
+
+// readFramedMessage reads one SIP message (headers terminated by a blank
+// line, followed by a Content-Length body) off of a stream. If maxSize is
+// greater than zero and the declared Content-Length exceeds it, it returns
+// errMessageTooLarge without reading the body, so a hostile or buggy peer
+// can't force an unbounded allocation.
+func readFramedMessage(reader *bufio.Reader, maxSize int) ([]byte, error) {
+	var head bytes.Buffer
+
+	headerObj := NewHeader()
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		head.WriteString(line)
+
+		trimmed := bytes.TrimRight([]byte(line), "\r\n")
+		if len(trimmed) == 0 {
+			break
+		}
+		if key, value, ok := bytes.Cut(trimmed, []byte{':'}); ok {
+			headerObj.Add(string(bytes.TrimSpace(key)), string(bytes.TrimSpace(value)))
+		}
+	}
+
+	length := contentLength(headerObj)
+	if maxSize > 0 && length > maxSize {
+		return nil, errMessageTooLarge
+	}
+
+	body := make([]byte, length)
+	if len(body) > 0 {
+		if _, err := io.ReadFull(reader, body); err != nil {
+			return nil, err
+		}
+	}
+
+	head.Write(body)
+	return head.Bytes(), nil
+}
+
+// getUDPConnFromPool returns the Conn associated with addr, creating and
+// pooling a new one if this is the first datagram seen from that peer.
+func (l *Listener) getUDPConnFromPool(addr net.Addr) *Conn {
+	l.udpPoolMutex.Lock()
+	defer l.udpPoolMutex.Unlock()
+
+	key := addr.String()
+	if c, ok := l.udpPool[key]; ok {
+		return c
+	}
+
+	c := &Conn{listener: l, transport: transportUDP, remote: addr, tag: l.tags[transportUDP]}
+	l.udpPool[key] = c
+	return c
+}
+
+// writeReceivedUDP parses a single UDP datagram as a complete SIP request
+// and hands it up through the listener's requestChannel.
+func (c *Conn) writeReceivedUDP(data []byte) {
+	if max := c.listener.maxMessageSize[transportUDP]; max > 0 && len(data) > max {
+		c.listener.requestChannel <- requestPackage{conn: c, err: errMessageTooLarge}
+		return
+	}
+
+	req, err := parseRequest(data)
+	c.listener.requestChannel <- requestPackage{conn: c, req: req, err: err}
+}
@@ -0,0 +1,71 @@
+package sipnet
+
+import "strings"
+
+// Header represents the headers of a SIP message. Lookups are
+// case-insensitive per RFC 3261 7.3.1, while Values preserves the order
+// headers were added in so headers that may repeat (Via, Route, ...) can be
+// walked in wire order.
+type Header struct {
+	fields map[string][]string
+	order  []string
+}
+
+// NewHeader returns an empty Header ready for use.
+func NewHeader() *Header {
+	return &Header{fields: make(map[string][]string)}
+}
+
+// Get returns the first value associated with key, or "" if key is not
+// present.
+func (h *Header) Get(key string) string {
+	vs := h.Values(key)
+	if len(vs) == 0 {
+		return ""
+	}
+	return vs[0]
+}
+
+// Values returns all values associated with key, in the order they were
+// added.
+func (h *Header) Values(key string) []string {
+	if h == nil {
+		return nil
+	}
+	return h.fields[strings.ToLower(key)]
+}
+
+// Set replaces all values associated with key.
+func (h *Header) Set(key, value string) {
+	k := strings.ToLower(key)
+	if _, ok := h.fields[k]; !ok {
+		h.order = append(h.order, k)
+	}
+	h.fields[k] = []string{value}
+}
+
+// Add appends value to the list of values associated with key.
+func (h *Header) Add(key, value string) {
+	k := strings.ToLower(key)
+	if _, ok := h.fields[k]; !ok {
+		h.order = append(h.order, k)
+	}
+	h.fields[k] = append(h.fields[k], value)
+}
+
+// SetFirst replaces only the first value associated with key, leaving any
+// further values (e.g. the remaining Via entries of a proxy chain) intact.
+// It is a no-op if key is not present.
+func (h *Header) SetFirst(key, value string) {
+	k := strings.ToLower(key)
+	vs, ok := h.fields[k]
+	if !ok || len(vs) == 0 {
+		return
+	}
+	vs[0] = value
+}
+
+// Keys returns the header names in the order they were first added.
+func (h *Header) Keys() []string {
+	return append([]string(nil), h.order...)
+}
@@ -1,12 +1,19 @@
 package sipnet
 
 import (
+	"context"
+	"crypto/tls"
 	"errors"
 	"net"
 	"sync"
 	"time"
 )
 
+// defaultIdleTimeout is how long a stream connection (TCP/TLS/WS) may sit
+// with no bytes read before it is closed, so a disappeared client doesn't
+// leak its reader goroutine forever. See SetIdleTimeout.
+const defaultIdleTimeout = 5 * time.Minute
+
 var (
 	// ErrClosed is returned if AcceptRequest is called on a closed listener.
 	// io.EOF may also be returned on a closed underlying connection, in which
@@ -25,7 +32,23 @@ type requestPackage struct {
 type Listener struct {
 	tcpListener net.Listener
 	udpListener *net.UDPConn
-	closed      bool
+	tlsListener net.Listener
+	wsListener  net.Listener
+
+	// done is closed exactly once, by Close or Shutdown, to signal that no
+	// further connections are being accepted; isClosed and AcceptRequest
+	// read it instead of a bare bool so they're safe to call concurrently
+	// with Close/Shutdown.
+	done      chan struct{}
+	closeOnce sync.Once
+
+	// connWG tracks registered stream connections (TCP/TLS/WS) still being
+	// served; txnWG tracks server transactions still in flight. Shutdown
+	// waits on both before returning.
+	connWG sync.WaitGroup
+	txnWG  sync.WaitGroup
+
+	idleTimeout time.Duration
 
 	requestChannel   chan requestPackage
 	receivedBranches map[string]time.Time
@@ -33,47 +56,193 @@ type Listener struct {
 
 	udpPool      map[string]*Conn
 	udpPoolMutex *sync.Mutex
+
+	// maxMessageSize, tags, and proxyProtocol are populated by
+	// ListenConfig.Listen, keyed by transport so e.g. a small cap on a
+	// public UDP entry isn't widened by a larger cap on another entry; they
+	// are zero-valued (no limit, no tag, no PROXY protocol) for Listeners
+	// built directly via Listen/ListenTLS/ListenWS.
+	maxMessageSize map[transportKind]int
+	tags           map[transportKind]string
+	proxyProtocol  map[transportKind]bool
+}
+
+// newListener returns a Listener with its bookkeeping structures
+// initialized but no transports started yet.
+func newListener() *Listener {
+	listener := &Listener{
+		done:             make(chan struct{}),
+		idleTimeout:      defaultIdleTimeout,
+		requestChannel:   make(chan requestPackage),
+		receivedBranches: make(map[string]time.Time),
+		branchMutex:      new(sync.Mutex),
+		udpPool:          make(map[string]*Conn),
+		udpPoolMutex:     new(sync.Mutex),
+		tags:             make(map[transportKind]string),
+		proxyProtocol:    make(map[transportKind]bool),
+		maxMessageSize:   make(map[transportKind]int),
+	}
+
+	go branchJanitor(listener)
+	return listener
+}
+
+// isClosed reports whether Close or Shutdown has been called.
+func (l *Listener) isClosed() bool {
+	select {
+	case <-l.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// SetIdleTimeout sets how long a stream connection (TCP/TLS/WS) may sit idle
+// before it is closed. It must be called before the relevant Listen*
+// method; zero disables idle timeouts entirely. The default is 5 minutes.
+func (l *Listener) SetIdleTimeout(d time.Duration) {
+	l.idleTimeout = d
 }
 
 // Listen listens on an address (IP:port) on both TCP and UDP.
 func Listen(addr string) (*Listener, error) {
+	listener := newListener()
+
+	if err := listener.ListenTCP(addr); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	if err := listener.ListenUDP(addr); err != nil {
+		listener.Close()
+		return nil, err
+	}
+
+	return listener, nil
+}
+
+// ListenTCP starts a plain TCP listener on addr, funneling requests into the
+// same AcceptRequest channel as any other transport already started on this
+// Listener. It may only be called once per Listener.
+func (l *Listener) ListenTCP(addr string) error {
+	if l.tcpListener != nil {
+		return errors.New("sip: TCP listener already started")
+	}
+
 	tcpListener, err := net.Listen("tcp", addr)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	l.tcpListener = tcpListener
+
+	go handleTCPListening(l)
+	return nil
+}
+
+// ListenUDP starts a plain UDP listener on addr, funneling requests into the
+// same AcceptRequest channel as any other transport already started on this
+// Listener. It may only be called once per Listener.
+func (l *Listener) ListenUDP(addr string) error {
+	if l.udpListener != nil {
+		return errors.New("sip: UDP listener already started")
 	}
 
 	udpAddr, err := net.ResolveUDPAddr("udp", addr)
 	if err != nil {
-		tcpListener.Close()
-		return nil, err
+		return err
 	}
 
 	udpListener, err := net.ListenUDP("udp", udpAddr)
 	if err != nil {
-		tcpListener.Close()
-		return nil, err
+		return err
 	}
+	l.udpListener = udpListener
 
-	listener := &Listener{
-		tcpListener:      tcpListener,
-		udpListener:      udpListener,
-		closed:           false,
-		requestChannel:   make(chan requestPackage),
-		receivedBranches: make(map[string]time.Time),
-		branchMutex:      new(sync.Mutex),
+	go handleUDPListening(l)
+	return nil
+}
+
+// ListenTLS starts an additional SIPS listener on addr (conventionally port
+// 5061) using cert for the server's identity, funneling requests into the
+// same AcceptRequest channel as the TCP/UDP listeners started by Listen.
+// It may only be called once per Listener.
+func (l *Listener) ListenTLS(addr string, cert tls.Certificate) error {
+	if l.tlsListener != nil {
+		return errors.New("sip: TLS listener already started")
 	}
 
-	go branchJanitor(listener)
-	go handleTCPListening(listener)
-	go handleUDPListening(listener)
+	tcpListener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
 
-	return listener, nil
+	// Wrap with our own listener, rather than tls.NewListener, so a
+	// configured PROXY protocol header can be stripped off the raw TCP
+	// conn before the TLS handshake reads from it; tls.NewListener would
+	// hand PROXY's plaintext bytes to the handshake as if they were a TLS
+	// record and fail.
+	l.tlsListener = &tlsListener{
+		Listener:      tcpListener,
+		config:        &tls.Config{Certificates: []tls.Certificate{cert}},
+		proxyProtocol: l.proxyProtocol[transportTLS],
+	}
+
+	go handleTLSListening(l)
+	return nil
+}
+
+// tlsListener performs the TLS handshake itself (instead of tls.NewListener)
+// so it can strip a leading PROXY protocol v2 header off of the raw TCP
+// conn first, when configured.
+type tlsListener struct {
+	net.Listener
+	config        *tls.Config
+	proxyProtocol bool
+}
+
+func (l *tlsListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+
+		if l.proxyProtocol {
+			wrapped, err := readProxyProtocolV2(conn)
+			if err != nil {
+				conn.Close()
+				continue
+			}
+			conn = wrapped
+		}
+
+		return tls.Server(conn, l.config), nil
+	}
+}
+
+// ListenWS starts an additional SIP-over-WebSocket listener on addr per RFC
+// 7118, funneling requests into the same AcceptRequest channel as the
+// TCP/UDP listeners started by Listen. It serves plain WS only and does not
+// terminate TLS itself; WSS needs a TLS terminator in front of addr.
+// It may only be called once per Listener.
+func (l *Listener) ListenWS(addr string) error {
+	if l.wsListener != nil {
+		return errors.New("sip: WS listener already started")
+	}
+
+	wsListener, err := newWSListener(addr)
+	if err != nil {
+		return err
+	}
+	l.wsListener = wsListener
+
+	go handleWSListening(l)
+	return nil
 }
 
 func branchJanitor(listener *Listener) {
 	for {
 		time.Sleep(time.Second * 10)
-		if listener.closed {
+		if listener.isClosed() {
 			return
 		}
 
@@ -93,7 +262,7 @@ func handleTCPListening(listener *Listener) {
 	for {
 		conn, err := listener.tcpListener.Accept()
 		if err != nil {
-			if listener.closed {
+			if listener.isClosed() {
 				return
 			}
 
@@ -110,6 +279,38 @@ func handleTCPListening(listener *Listener) {
 	}
 }
 
+func handleTLSListening(listener *Listener) {
+	for {
+		conn, err := listener.tlsListener.Accept()
+		if err != nil {
+			if listener.isClosed() {
+				return
+			}
+
+			listener.requestChannel <- requestPackage{err: err}
+			return
+		}
+
+		listener.registerStreamConn(conn, transportTLS)
+	}
+}
+
+func handleWSListening(listener *Listener) {
+	for {
+		conn, err := listener.wsListener.Accept()
+		if err != nil {
+			if listener.isClosed() {
+				return
+			}
+
+			listener.requestChannel <- requestPackage{err: err}
+			return
+		}
+
+		listener.registerStreamConn(conn, transportWS)
+	}
+}
+
 func handleUDPListening(listener *Listener) {
 	defer listener.Close()
 
@@ -117,7 +318,7 @@ func handleUDPListening(listener *Listener) {
 		data := make([]byte, 65535)
 		n, addr, err := listener.udpListener.ReadFrom(data)
 		if err != nil {
-			if listener.closed {
+			if listener.isClosed() {
 				return
 			}
 
@@ -134,14 +335,35 @@ func handleUDPListening(listener *Listener) {
 	}
 }
 
+// receiveRequest waits for the next requestPackage, preferring one that's
+// already waiting even if the listener has since been closed, so a call to
+// Shutdown lets requests already in flight drain through AcceptRequest
+// instead of being dropped the instant it's called. Only once nothing is
+// immediately available does it also watch done, so a caller blocked here
+// when Close/Shutdown runs wakes up promptly instead of hanging forever.
+func (l *Listener) receiveRequest() (requestPackage, bool) {
+	select {
+	case resp := <-l.requestChannel:
+		return resp, true
+	default:
+	}
+
+	select {
+	case resp := <-l.requestChannel:
+		return resp, true
+	case <-l.done:
+		return requestPackage{}, false
+	}
+}
+
 // AcceptRequest blocks until it receives a Request message on either TCP or UDP
 // listeners. Responses are to be written to *Conn (and then flushed).
 func (l *Listener) AcceptRequest() (*Request, *Conn, error) {
 	for {
-		if l.closed {
+		resp, ok := l.receiveRequest()
+		if !ok {
 			return nil, nil, ErrClosed
 		}
-		resp := <-l.requestChannel
 
 		if resp.err == nil {
 			via, err := ParseVia(resp.req.Header.Get("Via"))
@@ -149,19 +371,34 @@ func (l *Listener) AcceptRequest() (*Request, *Conn, error) {
 				return resp.req, resp.conn, err
 			}
 
+			if resp.conn.transport == transportUDP {
+				resp.conn.applyReceivedRport(via)
+				resp.req.Header.SetFirst("Via", via.String())
+			}
+
 			branch := via.Arguments.Get("branch")
 			if branch == "" || len(branch) < 8 || branch[:7] != "z9hG4bK" {
 				return resp.req, resp.conn, ErrInvalidBranch
 			}
 
+			// Dedup by branch+method, not branch alone: a non-2xx ACK
+			// legitimately reuses its INVITE's branch (RFC 3261 17.1.1.3)
+			// and must still reach AcceptTransaction for absorption.
+			dedupKey := branch + "|" + resp.req.Method
+
 			l.branchMutex.Lock()
-			if _, found := l.receivedBranches[branch]; found {
-				// Repeated message, ignore.
+			if _, found := l.receivedBranches[dedupKey]; found {
 				l.branchMutex.Unlock()
+				// Repeated message: let the owning server transaction, if
+				// any, resend its last final response instead of
+				// re-running application logic.
+				if resp.conn.txn != nil && resp.conn.txn.Branch() == branch {
+					resp.conn.txn.ReceiveRequest()
+				}
 				continue
 			}
 
-			l.receivedBranches[branch] = time.Now()
+			l.receivedBranches[dedupKey] = time.Now()
 			l.branchMutex.Unlock()
 		}
 
@@ -169,15 +406,11 @@ func (l *Listener) AcceptRequest() (*Request, *Conn, error) {
 	}
 }
 
-// Close closes both TCP and UDP listeners, and returns
+// Close stops accepting new connections and requests immediately, without
+// waiting for in-flight requests or registered connections to finish. Most
+// callers wanting a clean shutdown should use Shutdown instead.
 func (l *Listener) Close() error {
-	l.closed = true
-	err := l.tcpListener.Close()
-	if err != nil {
-		l.udpListener.Close()
-	} else {
-		err = l.udpListener.Close()
-	}
+	err := l.closeListeners()
 
 closeLoop:
 	for {
@@ -191,7 +424,76 @@ closeLoop:
 	return err
 }
 
-// Addr returns the address the listener is listening on.
+// Shutdown stops accepting new connections and requests, then blocks until
+// every registered connection has been closed and every server transaction
+// created via AcceptTransaction has reached a terminal state - so a
+// transaction's final response (and its retransmissions) still go out -
+// or until ctx is done, whichever comes first. The caller's AcceptRequest /
+// AcceptTransaction loop must keep running during this call so in-flight
+// requests can still be drained; see receiveRequest.
+func (l *Listener) Shutdown(ctx context.Context) error {
+	if err := l.closeListeners(); err != nil {
+		return err
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		l.connWG.Wait()
+		l.txnWG.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// closeListeners marks the Listener closed and closes every underlying
+// transport listener, without touching already-registered connections.
+func (l *Listener) closeListeners() error {
+	l.closeOnce.Do(func() { close(l.done) })
+
+	var err error
+	if l.tcpListener != nil {
+		err = l.tcpListener.Close()
+	}
+	if l.udpListener != nil {
+		if udpErr := l.udpListener.Close(); err == nil {
+			err = udpErr
+		}
+	}
+	if l.tlsListener != nil {
+		if tlsErr := l.tlsListener.Close(); err == nil {
+			err = tlsErr
+		}
+	}
+	if l.wsListener != nil {
+		if wsErr := l.wsListener.Close(); err == nil {
+			err = wsErr
+		}
+	}
+
+	return err
+}
+
+// Addr returns the address of the first bound underlying listener, checked
+// in the order TCP, TLS, WS, UDP, or nil if none have been started. A
+// Listener built from a multi-transport ListenConfig may have several;
+// only the first of them is reported.
 func (l *Listener) Addr() net.Addr {
-	return l.tcpListener.Addr()
+	switch {
+	case l.tcpListener != nil:
+		return l.tcpListener.Addr()
+	case l.tlsListener != nil:
+		return l.tlsListener.Addr()
+	case l.wsListener != nil:
+		return l.wsListener.Addr()
+	case l.udpListener != nil:
+		return l.udpListener.LocalAddr()
+	default:
+		return nil
+	}
 }
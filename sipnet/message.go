@@ -0,0 +1,100 @@
+package sipnet
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// ErrMalformedRequest is returned when a raw message cannot be parsed as a
+// SIP request.
+var ErrMalformedRequest = errors.New("sip: malformed request")
+
+// errMessageTooLarge is returned when a message's declared Content-Length
+// (or, on UDP, the datagram's length) exceeds the listener's configured
+// MaxMessageSize.
+var errMessageTooLarge = errors.New("sip: message exceeds max message size")
+
+// parseRequest parses a complete SIP request (request line, headers, and
+// body) out of raw.
+func parseRequest(raw []byte) (*Request, error) {
+	reader := bufio.NewReader(bytes.NewReader(raw))
+
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, ErrMalformedRequest
+	}
+	parts := strings.Fields(line)
+	if len(parts) != 3 {
+		return nil, ErrMalformedRequest
+	}
+
+	req := &Request{
+		Method:     parts[0],
+		RequestURI: parts[1],
+		Version:    strings.TrimSpace(parts[2]),
+		Header:     NewHeader(),
+	}
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, ErrMalformedRequest
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, ErrMalformedRequest
+		}
+		req.Header.Add(strings.TrimSpace(key), strings.TrimSpace(value))
+	}
+
+	body, _ := reader.ReadString(0)
+	req.Body = []byte(body)
+
+	return req, nil
+}
+
+// marshalResponse renders resp into its wire representation.
+func marshalResponse(resp *Response) []byte {
+	var b bytes.Buffer
+
+	b.WriteString(resp.Version)
+	b.WriteByte(' ')
+	b.WriteString(strconv.Itoa(resp.StatusCode))
+	b.WriteByte(' ')
+	b.WriteString(resp.Reason)
+	b.WriteString("\r\n")
+
+	for _, key := range resp.Header.Keys() {
+		for _, v := range resp.Header.Values(key) {
+			b.WriteString(key)
+			b.WriteString(": ")
+			b.WriteString(v)
+			b.WriteString("\r\n")
+		}
+	}
+
+	b.WriteString("Content-Length: ")
+	b.WriteString(strconv.Itoa(len(resp.Body)))
+	b.WriteString("\r\n\r\n")
+	b.Write(resp.Body)
+
+	return b.Bytes()
+}
+
+// contentLength reads the Content-Length header from h, defaulting to 0 if
+// absent or unparsable.
+func contentLength(h *Header) int {
+	n, err := strconv.Atoi(h.Get("Content-Length"))
+	if err != nil {
+		return 0
+	}
+	return n
+}
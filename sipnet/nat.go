@@ -0,0 +1,28 @@
+package sipnet
+
+import (
+	"net"
+	"strconv"
+)
+
+// applyReceivedRport implements RFC 3581: when a request arrives over UDP,
+// the topmost Via must be annotated with received= if the actual source
+// address doesn't match the Via's sent-by host, and with rport= (replacing
+// the bare "rport" parameter) if the client requested it, so that responses
+// - including ones generated further up the proxy chain - route back to
+// where the request actually came from rather than to an unroutable address
+// behind NAT.
+func (c *Conn) applyReceivedRport(via *Via) {
+	udpAddr, ok := c.remote.(*net.UDPAddr)
+	if !ok {
+		return
+	}
+
+	if udpAddr.IP.String() != via.Host {
+		via.Arguments.Set("received", udpAddr.IP.String())
+	}
+
+	if via.Arguments.Has("rport") {
+		via.Arguments.Set("rport", strconv.Itoa(udpAddr.Port))
+	}
+}
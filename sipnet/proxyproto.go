@@ -0,0 +1,100 @@
+package sipnet
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+)
+
+// errProxyProtocol is returned when a stream's leading bytes don't form a
+// valid PROXY protocol v2 header.
+var errProxyProtocol = errors.New("sip: malformed PROXY protocol header")
+
+// proxyProtocolV2Signature is the fixed 12-byte prefix of every PROXY
+// protocol v2 header (haproxy/PROXY-protocol.txt section 2.2).
+var proxyProtocolV2Signature = [12]byte{0x0D, 0x0A, 0x0D, 0x0A, 0x00, 0x0D, 0x0A, 0x51, 0x55, 0x49, 0x54, 0x0A}
+
+// proxyProtoConn overrides RemoteAddr with the original client address
+// carried in a PROXY protocol v2 header, so requests relayed through a
+// load balancer (e.g. HAProxy) still see the real client's address rather
+// than the balancer's.
+type proxyProtoConn struct {
+	net.Conn
+	reader *bufio.Reader
+	remote net.Addr
+}
+
+func (c *proxyProtoConn) Read(p []byte) (int, error) { return c.reader.Read(p) }
+
+func (c *proxyProtoConn) RemoteAddr() net.Addr {
+	if c.remote != nil {
+		return c.remote
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// readProxyProtocolV2 consumes and parses a leading PROXY protocol v2
+// header from conn, returning a net.Conn whose RemoteAddr reports the
+// original client address rather than the proxy's.
+func readProxyProtocolV2(conn net.Conn) (net.Conn, error) {
+	reader := bufio.NewReader(conn)
+
+	sig := make([]byte, len(proxyProtocolV2Signature))
+	if _, err := io.ReadFull(reader, sig); err != nil {
+		return nil, err
+	}
+	for i, b := range sig {
+		if b != proxyProtocolV2Signature[i] {
+			return nil, errProxyProtocol
+		}
+	}
+
+	verCmd, err := reader.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	if verCmd>>4 != 2 {
+		return nil, errProxyProtocol
+	}
+
+	famProto, err := reader.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	lengthBuf := make([]byte, 2)
+	if _, err := io.ReadFull(reader, lengthBuf); err != nil {
+		return nil, err
+	}
+	length := binary.BigEndian.Uint16(lengthBuf)
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(reader, body); err != nil {
+		return nil, err
+	}
+
+	pc := &proxyProtoConn{Conn: conn, reader: reader}
+
+	switch famProto >> 4 {
+	case 1: // AF_INET
+		if len(body) >= 12 {
+			pc.remote = &net.TCPAddr{
+				IP:   net.IP(body[0:4]),
+				Port: int(binary.BigEndian.Uint16(body[8:10])),
+			}
+		}
+	case 2: // AF_INET6
+		if len(body) >= 36 {
+			pc.remote = &net.TCPAddr{
+				IP:   net.IP(body[0:16]),
+				Port: int(binary.BigEndian.Uint16(body[32:34])),
+			}
+		}
+		// LOCAL connections (health checks) and unsupported families carry
+		// no usable address; fall back to the proxy's own RemoteAddr.
+	}
+
+	return pc, nil
+}
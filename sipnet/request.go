@@ -0,0 +1,43 @@
+package sipnet
+
+// Request represents a parsed SIP request line plus headers and body.
+type Request struct {
+	Method     string
+	RequestURI string
+	Version    string
+	Header     *Header
+	Body       []byte
+}
+
+// Response represents a SIP status line plus headers and body, ready to be
+// written back to a Conn.
+type Response struct {
+	Version    string
+	StatusCode int
+	Reason     string
+	Header     *Header
+	Body       []byte
+
+	req *Request
+}
+
+// NewResponse builds a Response for req with the given status code and
+// reason phrase, copying req's Via, From, To, Call-ID and CSeq so the caller
+// only needs to fill in anything status-specific.
+func NewResponse(req *Request, statusCode int, reason string) *Response {
+	resp := &Response{
+		Version:    "SIP/2.0",
+		StatusCode: statusCode,
+		Reason:     reason,
+		Header:     NewHeader(),
+		req:        req,
+	}
+
+	for _, key := range []string{"Via", "From", "To", "Call-ID", "CSeq"} {
+		for _, v := range req.Header.Values(key) {
+			resp.Header.Add(key, v)
+		}
+	}
+
+	return resp
+}
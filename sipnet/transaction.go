@@ -0,0 +1,75 @@
+package sipnet
+
+import "github.com/kascad/go-sip/sipnet/transaction"
+
+// ServerTransaction pairs a transaction.ServerTransaction with the request
+// and Conn it was created for, so callers of AcceptTransaction don't need a
+// separate AcceptRequest call to get at them.
+type ServerTransaction struct {
+	*transaction.ServerTransaction
+	Request *Request
+	Conn    *Conn
+}
+
+// AcceptTransaction is AcceptRequest plus an RFC 3261 17.2 server
+// transaction: it sends the automatic 100 Trying for INVITE requests,
+// absorbs non-2xx ACKs that belong to an existing transaction instead of
+// returning them as new requests, and arranges for Conn.WriteResponse on
+// the returned Conn to retransmit final responses automatically over
+// unreliable transports. ACKs to a 2xx response are end-to-end and have no
+// server transaction of their own, so they are still returned as a request
+// for the TU to handle.
+func (l *Listener) AcceptTransaction() (*ServerTransaction, error) {
+	for {
+		req, conn, err := l.AcceptRequest()
+		if err != nil {
+			return nil, err
+		}
+
+		branch := requestBranch(req)
+
+		if req.Method == "ACK" {
+			if conn.txn != nil && conn.txn.Branch() == branch {
+				// ACK to a non-2xx final response shares its INVITE's
+				// branch and belongs to that transaction; absorb it.
+				conn.txn.ReceiveACK()
+				continue
+			}
+
+			// ACK to a 2xx final response carries a new branch and is an
+			// end-to-end message with no server transaction of its own
+			// (RFC 3261 13.3.1.4): it must still reach the TU, so return
+			// it like any other request rather than dropping it. It isn't
+			// tracked in txnWG or wired as conn.txn since it never gets a
+			// response to retransmit and must not displace an INVITE
+			// transaction still using the same Conn.
+			txn := transaction.NewServerTransaction(req.Method, branch, conn, conn.transport != transportUDP)
+			return &ServerTransaction{ServerTransaction: txn, Request: req, Conn: conn}, nil
+		}
+
+		txn := transaction.NewServerTransaction(req.Method, branch, conn, conn.transport != transportUDP)
+		conn.txn = txn
+
+		l.txnWG.Add(1)
+		go func() {
+			defer l.txnWG.Done()
+			<-txn.Done()
+		}()
+
+		if req.Method == "INVITE" {
+			conn.WriteResponse(NewResponse(req, 100, "Trying"))
+		}
+
+		return &ServerTransaction{ServerTransaction: txn, Request: req, Conn: conn}, nil
+	}
+}
+
+// requestBranch returns the branch parameter of req's topmost Via, or "" if
+// it is missing or malformed.
+func requestBranch(req *Request) string {
+	via, err := ParseVia(req.Header.Get("Via"))
+	if err != nil {
+		return ""
+	}
+	return via.Arguments.Get("branch")
+}
@@ -0,0 +1,212 @@
+package transaction
+
+import (
+	"sync"
+	"time"
+)
+
+// timeoutError is the type of ErrTimeout, delivered when a client
+// transaction gives up waiting for a final response (Timer B for INVITE,
+// Timer F for non-INVITE).
+type timeoutError struct{}
+
+func (timeoutError) Error() string { return "sip: transaction timed out" }
+
+// ErrTimeout is the error delivered to the transaction's final response
+// channel when Timer B/F fires before a final response arrives.
+var ErrTimeout error = timeoutError{}
+
+// ClientTransaction drives the RFC 3261 17.1 client transaction state
+// machine for a single outgoing request: it retransmits the request over
+// unreliable transports until a response arrives, and times the whole
+// exchange out per Timer B (INVITE) or Timer F (non-INVITE).
+type ClientTransaction struct {
+	mu sync.Mutex
+
+	branch   string
+	isInvite bool
+	reliable bool
+	out      Responder
+	request  []byte
+
+	state State
+
+	retransmitTimer *time.Timer
+	timeoutTimer    *time.Timer
+	expiryTimer     *time.Timer
+
+	responses chan []byte
+	errors    chan error
+	done      chan struct{}
+}
+
+// NewClientTransaction creates a client transaction in the Trying/Calling
+// state and immediately sends request, starting the retransmit (A/E) timer
+// for unreliable transports and the timeout (B/F) timer for all transports.
+func NewClientTransaction(method, branch string, request []byte, out Responder, reliable bool) *ClientTransaction {
+	t := &ClientTransaction{
+		branch:    branch,
+		isInvite:  method == "INVITE",
+		reliable:  reliable,
+		out:       out,
+		request:   request,
+		state:     Trying,
+		responses: make(chan []byte, 1),
+		errors:    make(chan error, 1),
+		done:      make(chan struct{}),
+	}
+
+	t.out.WriteRaw(request)
+
+	if !reliable {
+		if t.isInvite {
+			t.scheduleRetransmit(TimerA)
+		} else {
+			t.scheduleRetransmit(TimerE)
+		}
+	}
+
+	timeout := TimerF
+	if t.isInvite {
+		timeout = TimerB
+	}
+	t.timeoutTimer = time.AfterFunc(timeout, func() { t.fail(ErrTimeout) })
+
+	return t
+}
+
+// Branch returns the branch parameter identifying this transaction.
+func (t *ClientTransaction) Branch() string {
+	return t.branch
+}
+
+// State returns the transaction's current state.
+func (t *ClientTransaction) State() State {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.state
+}
+
+// Responses yields each response as it is delivered via Receive.
+func (t *ClientTransaction) Responses() <-chan []byte {
+	return t.responses
+}
+
+// Err yields ErrTimeout if the transaction times out before a final
+// response arrives.
+func (t *ClientTransaction) Err() <-chan error {
+	return t.errors
+}
+
+// Done is closed once the transaction reaches Terminated.
+func (t *ClientTransaction) Done() <-chan struct{} {
+	return t.done
+}
+
+// Receive delivers a response with the given status code to the
+// transaction. Any response stops retransmission of an INVITE; a non-INVITE
+// request keeps being retransmitted until a final response arrives. A final
+// response starts Timer D/K before the transaction terminates (absorbing any
+// further retransmitted final responses in the meantime).
+func (t *ClientTransaction) Receive(data []byte, statusCode int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.state == Terminated || t.state == Completed {
+		return
+	}
+
+	if statusCode < 200 {
+		t.state = Proceeding
+		t.nonBlockingSend(data)
+		return
+	}
+
+	if t.retransmitTimer != nil {
+		t.retransmitTimer.Stop()
+	}
+	if t.timeoutTimer != nil {
+		t.timeoutTimer.Stop()
+	}
+
+	t.state = Completed
+	t.nonBlockingSend(data)
+
+	if t.reliable {
+		t.terminateLocked()
+		return
+	}
+
+	wait := TimerK
+	if t.isInvite {
+		wait = TimerD
+	}
+	t.expiryTimer = time.AfterFunc(wait, t.terminate)
+}
+
+func (t *ClientTransaction) nonBlockingSend(data []byte) {
+	select {
+	case t.responses <- data:
+	default:
+	}
+}
+
+func (t *ClientTransaction) fail(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.state == Terminated || t.state == Completed {
+		return
+	}
+
+	select {
+	case t.errors <- err:
+	default:
+	}
+	t.terminateLocked()
+}
+
+func (t *ClientTransaction) scheduleRetransmit(interval time.Duration) {
+	t.retransmitTimer = time.AfterFunc(interval, func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+
+		if t.state != Trying && (t.isInvite || t.state != Proceeding) {
+			return
+		}
+		t.out.WriteRaw(t.request)
+
+		next := interval * 2
+		cap := TimerF
+		if next > cap {
+			next = cap
+		}
+		if !t.isInvite && next > T2 {
+			next = T2
+		}
+		t.scheduleRetransmit(next)
+	})
+}
+
+func (t *ClientTransaction) terminate() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.terminateLocked()
+}
+
+func (t *ClientTransaction) terminateLocked() {
+	if t.state == Terminated {
+		return
+	}
+	if t.retransmitTimer != nil {
+		t.retransmitTimer.Stop()
+	}
+	if t.timeoutTimer != nil {
+		t.timeoutTimer.Stop()
+	}
+	if t.expiryTimer != nil {
+		t.expiryTimer.Stop()
+	}
+	t.state = Terminated
+	close(t.done)
+}
@@ -0,0 +1,6 @@
+// Package transaction implements the RFC 3261 17 client and server
+// transaction state machines (both INVITE and non-INVITE), including their
+// retransmission and timeout timers. It is transport-agnostic: callers
+// supply a Responder that writes already-serialized messages to the wire,
+// and the transaction decides when and how often to call it.
+package transaction
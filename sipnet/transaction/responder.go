@@ -0,0 +1,8 @@
+package transaction
+
+// Responder writes an already-serialized SIP message back to the peer a
+// transaction is communicating with. Implementations typically wrap a
+// stream or UDP socket; sipnet.Conn satisfies this interface.
+type Responder interface {
+	WriteRaw(data []byte) error
+}
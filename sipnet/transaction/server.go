@@ -0,0 +1,199 @@
+package transaction
+
+import (
+	"sync"
+	"time"
+)
+
+// ServerTransaction drives the RFC 3261 17.2 server transaction state
+// machine for a single incoming request: over unreliable transports it
+// retransmits a non-2xx INVITE final response on Timer G until the matching
+// ACK arrives, resends the last final response whenever the request is
+// re-delivered, and absorbs ACKs that belong to it.
+type ServerTransaction struct {
+	mu sync.Mutex
+
+	branch   string
+	isInvite bool
+	reliable bool
+	out      Responder
+
+	state     State
+	lastFinal []byte
+
+	retransmitTimer *time.Timer
+	expiryTimer     *time.Timer
+
+	done chan struct{}
+}
+
+// NewServerTransaction creates a server transaction in the Trying state for
+// an incoming request identified by method and branch. reliable should be
+// true for stream transports (TCP/TLS/WS), which per 17.1.1.2/17.2.1 never
+// need application-level retransmission.
+func NewServerTransaction(method, branch string, out Responder, reliable bool) *ServerTransaction {
+	return &ServerTransaction{
+		branch:   branch,
+		isInvite: method == "INVITE",
+		reliable: reliable,
+		out:      out,
+		state:    Trying,
+		done:     make(chan struct{}),
+	}
+}
+
+// Branch returns the branch parameter identifying this transaction.
+func (t *ServerTransaction) Branch() string {
+	return t.branch
+}
+
+// State returns the transaction's current state.
+func (t *ServerTransaction) State() State {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.state
+}
+
+// Done is closed once the transaction reaches Terminated.
+func (t *ServerTransaction) Done() <-chan struct{} {
+	return t.done
+}
+
+// SendProvisional writes a 1xx response (including the automatic 100
+// Trying) and moves an INVITE transaction to Proceeding. It is sent exactly
+// once; 1xx responses are not retransmitted.
+func (t *ServerTransaction) SendProvisional(data []byte) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.state != Trying && t.state != Proceeding {
+		return nil
+	}
+	t.state = Proceeding
+
+	return t.out.WriteRaw(data)
+}
+
+// SendFinal writes a final (2xx-6xx) response. For INVITE transactions over
+// unreliable transports it starts Timer G to retransmit the response until
+// ACK arrives or Timer H expires; non-2xx INVITE responses then wait out
+// Timer I in Confirmed before terminating. 2xx responses to INVITE, and all
+// non-INVITE final responses, terminate on their own per 17.2.1/17.2.2 once
+// the retransmission window closes (Timer J / immediately for 2xx INVITE,
+// whose retransmission is the TU's responsibility once this transaction
+// hands off).
+func (t *ServerTransaction) SendFinal(data []byte, statusCode int) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.state == Completed || t.state == Confirmed || t.state == Terminated {
+		return nil
+	}
+
+	t.state = Completed
+	t.lastFinal = data
+
+	if err := t.out.WriteRaw(data); err != nil {
+		return err
+	}
+
+	switch {
+	case t.isInvite && statusCode >= 300:
+		if t.reliable {
+			t.scheduleExpiry(TimerH, t.terminate)
+		} else {
+			t.scheduleRetransmit(TimerG)
+			t.scheduleExpiry(TimerH, t.terminate)
+		}
+	case t.isInvite:
+		// 2xx responses to INVITE are retransmitted by the TU (the caller),
+		// not the transaction, until ACK arrives on a separate dialog match;
+		// this transaction's job ends here.
+		t.terminateLocked()
+	default:
+		if t.reliable {
+			t.terminateLocked()
+		} else {
+			t.scheduleExpiry(TimerJ, t.terminate)
+		}
+	}
+
+	return nil
+}
+
+// ReceiveACK reports that an ACK matching this transaction's branch has
+// arrived. For non-2xx INVITE transactions this stops retransmission and
+// moves to Confirmed to absorb any further ACK retransmissions during
+// Timer I; it has no effect on non-INVITE transactions, which have no ACK.
+func (t *ServerTransaction) ReceiveACK() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !t.isInvite || t.state != Completed {
+		return
+	}
+
+	if t.retransmitTimer != nil {
+		t.retransmitTimer.Stop()
+	}
+	if t.expiryTimer != nil {
+		t.expiryTimer.Stop()
+	}
+
+	t.state = Confirmed
+	t.scheduleExpiry(TimerI, t.terminate)
+}
+
+// ReceiveRequest reports a retransmission of the original request (observed
+// by the owning Listener matching this transaction's branch again) so the
+// last final response can be resent without re-running application logic.
+func (t *ServerTransaction) ReceiveRequest() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.state == Completed && t.lastFinal != nil {
+		t.out.WriteRaw(t.lastFinal)
+	}
+}
+
+func (t *ServerTransaction) scheduleRetransmit(interval time.Duration) {
+	t.retransmitTimer = time.AfterFunc(interval, func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+
+		if t.state != Completed || t.lastFinal == nil {
+			return
+		}
+		t.out.WriteRaw(t.lastFinal)
+
+		next := interval * 2
+		if next > T2 {
+			next = T2
+		}
+		t.scheduleRetransmit(next)
+	})
+}
+
+func (t *ServerTransaction) scheduleExpiry(d time.Duration, fn func()) {
+	t.expiryTimer = time.AfterFunc(d, fn)
+}
+
+func (t *ServerTransaction) terminate() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.terminateLocked()
+}
+
+func (t *ServerTransaction) terminateLocked() {
+	if t.state == Terminated {
+		return
+	}
+	if t.retransmitTimer != nil {
+		t.retransmitTimer.Stop()
+	}
+	if t.expiryTimer != nil {
+		t.expiryTimer.Stop()
+	}
+	t.state = Terminated
+	close(t.done)
+}
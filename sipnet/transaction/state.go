@@ -0,0 +1,31 @@
+package transaction
+
+// State is a transaction state from the RFC 3261 17.1/17.2 INVITE and
+// non-INVITE client/server state machines. Not every state applies to every
+// machine: Confirmed is used only by server INVITE transactions.
+type State int
+
+const (
+	Trying State = iota
+	Proceeding
+	Completed
+	Confirmed // server INVITE only
+	Terminated
+)
+
+func (s State) String() string {
+	switch s {
+	case Trying:
+		return "Trying"
+	case Proceeding:
+		return "Proceeding"
+	case Completed:
+		return "Completed"
+	case Confirmed:
+		return "Confirmed"
+	case Terminated:
+		return "Terminated"
+	default:
+		return "Unknown"
+	}
+}
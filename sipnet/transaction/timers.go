@@ -0,0 +1,30 @@
+package transaction
+
+import "time"
+
+// Timer durations from RFC 3261 Appendix A. T1 is the RTT estimate, T2 caps
+// the non-INVITE/INVITE-response retransmit interval, and T4 is the maximum
+// duration a message can remain in the network.
+const (
+	T1 = 500 * time.Millisecond
+	T2 = 4 * time.Second
+	T4 = 5 * time.Second
+)
+
+// Client transaction timers (RFC 3261 17.1.1.2, 17.1.2.2).
+const (
+	TimerA = T1      // INVITE request retransmit interval, doubles until B
+	TimerB = 64 * T1 // INVITE transaction timeout
+	TimerD = 32 * time.Second
+	TimerE = T1      // non-INVITE request retransmit interval, caps at T2
+	TimerF = 64 * T1 // non-INVITE transaction timeout
+	TimerK = T4
+)
+
+// Server transaction timers (RFC 3261 17.2.1, 17.2.2).
+const (
+	TimerG = T1 // INVITE final response retransmit interval, caps at T2
+	TimerH = 64 * T1
+	TimerI = T4
+	TimerJ = 64 * T1
+)
@@ -0,0 +1,174 @@
+package sipnet
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// ErrMalformedVia is returned by ParseVia when the header value isn't a
+// well-formed Via per RFC 3261 20.42.
+var ErrMalformedVia = errors.New("sip: malformed via")
+
+// Arguments holds the semicolon-separated parameters of a Via (or similarly
+// shaped) header value, e.g. the "branch=z9hG4bK776asdhds;rport" portion.
+// A bare parameter name such as "rport" is stored with an empty value and
+// Has reports it present.
+type Arguments struct {
+	pairs map[string]string
+	order []string
+}
+
+// NewArguments returns an empty Arguments ready for use.
+func NewArguments() *Arguments {
+	return &Arguments{pairs: make(map[string]string)}
+}
+
+// Get returns the value of key, or "" if it is absent.
+func (a *Arguments) Get(key string) string {
+	if a == nil {
+		return ""
+	}
+	return a.pairs[key]
+}
+
+// Has reports whether key was present, including bare (value-less)
+// parameters like "rport".
+func (a *Arguments) Has(key string) bool {
+	if a == nil {
+		return false
+	}
+	_, ok := a.pairs[key]
+	return ok
+}
+
+// Set adds or overwrites key with value. Setting a bare parameter (no "=")
+// should pass value == "".
+func (a *Arguments) Set(key, value string) {
+	if _, ok := a.pairs[key]; !ok {
+		a.order = append(a.order, key)
+	}
+	a.pairs[key] = value
+}
+
+// String renders the arguments back into ";key=value;key" form, in the
+// order they were added.
+func (a *Arguments) String() string {
+	if a == nil || len(a.order) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	for _, key := range a.order {
+		b.WriteByte(';')
+		b.WriteString(key)
+		if v := a.pairs[key]; v != "" {
+			b.WriteByte('=')
+			b.WriteString(v)
+		}
+	}
+	return b.String()
+}
+
+// Via represents a single Via header value: the protocol/transport and
+// sent-by host:port the request was forwarded from, plus its parameters.
+type Via struct {
+	Protocol  string // e.g. "SIP/2.0"
+	Transport string // "UDP", "TCP", "TLS", or "WS"
+	Host      string
+	Port      int
+	Arguments *Arguments
+}
+
+// ParseVia parses a single Via header value such as:
+//
+//	SIP/2.0/UDP pc33.example.com:5060;branch=z9hG4bK776asdhds
+func ParseVia(raw string) (*Via, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil, ErrMalformedVia
+	}
+
+	sentProtocol, rest, ok := strings.Cut(raw, " ")
+	if !ok {
+		return nil, ErrMalformedVia
+	}
+
+	protoParts := strings.Split(sentProtocol, "/")
+	if len(protoParts) != 3 {
+		return nil, ErrMalformedVia
+	}
+
+	via := &Via{
+		Protocol:  protoParts[0] + "/" + protoParts[1],
+		Transport: strings.ToUpper(protoParts[2]),
+		Arguments: NewArguments(),
+	}
+
+	rest = strings.TrimSpace(rest)
+	sentBy := rest
+	if idx := strings.IndexByte(rest, ';'); idx >= 0 {
+		sentBy = rest[:idx]
+		if err := parseArguments(rest[idx:], via.Arguments); err != nil {
+			return nil, err
+		}
+	}
+
+	host, port, err := splitHostPort(sentBy)
+	if err != nil {
+		return nil, err
+	}
+	via.Host = host
+	via.Port = port
+
+	return via, nil
+}
+
+func parseArguments(raw string, args *Arguments) error {
+	for _, param := range strings.Split(raw, ";") {
+		if param == "" {
+			continue
+		}
+		if key, value, ok := strings.Cut(param, "="); ok {
+			args.Set(key, value)
+		} else {
+			args.Set(param, "")
+		}
+	}
+	return nil
+}
+
+// splitHostPort splits a sent-by "host" or "host:port" value. Unlike
+// net.SplitHostPort it tolerates the port being absent.
+func splitHostPort(hostport string) (string, int, error) {
+	if hostport == "" {
+		return "", 0, ErrMalformedVia
+	}
+
+	host, portStr, ok := strings.Cut(hostport, ":")
+	if !ok {
+		return host, 0, nil
+	}
+
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return "", 0, ErrMalformedVia
+	}
+	return host, port, nil
+}
+
+// String renders the Via back into wire form.
+func (v *Via) String() string {
+	var b strings.Builder
+	b.WriteString(v.Protocol)
+	b.WriteByte('/')
+	b.WriteString(v.Transport)
+	b.WriteByte(' ')
+	b.WriteString(v.Host)
+	if v.Port != 0 {
+		b.WriteByte(':')
+		b.WriteString(strconv.Itoa(v.Port))
+	}
+	b.WriteString(v.Arguments.String())
+	return b.String()
+}
@@ -0,0 +1,211 @@
+package sipnet
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+)
+
+// wsMagic is the fixed GUID used to compute Sec-WebSocket-Accept per RFC
+// 6455 section 1.3.
+const wsMagic = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+var errWSHandshake = errors.New("sip: websocket handshake failed")
+
+// wsListener accepts raw TCP connections and performs the RFC 6455 opening
+// handshake on each one before handing back a net.Conn whose Read/Write
+// transparently frame/unframe WebSocket binary messages, so the rest of the
+// stack can treat it like any other stream transport.
+type wsListener struct {
+	net.Listener
+}
+
+// newWSListener listens on addr and returns a net.Listener whose Accept
+// blocks until a client has completed the WebSocket handshake, requesting
+// the "sip" subprotocol per RFC 7118.
+func newWSListener(addr string) (net.Listener, error) {
+	tcp, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &wsListener{Listener: tcp}, nil
+}
+
+func (l *wsListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+
+		ws, err := wsHandshake(conn)
+		if err != nil {
+			conn.Close()
+			continue
+		}
+		return ws, nil
+	}
+}
+
+// wsHandshake reads the HTTP upgrade request off of conn, validates it, and
+// writes the 101 response, returning a wsConn wrapping the now-upgraded
+// connection.
+func wsHandshake(conn net.Conn) (net.Conn, error) {
+	reader := bufio.NewReader(conn)
+
+	req, err := http.ReadRequest(reader)
+	if err != nil {
+		return nil, errWSHandshake
+	}
+
+	key := req.Header.Get("Sec-WebSocket-Key")
+	if key == "" || req.Header.Get("Upgrade") != "websocket" {
+		return nil, errWSHandshake
+	}
+
+	accept := wsAcceptKey(key)
+
+	resp := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Protocol: sip\r\n" +
+		"Sec-WebSocket-Accept: " + accept + "\r\n\r\n"
+
+	if _, err := io.WriteString(conn, resp); err != nil {
+		return nil, err
+	}
+
+	return &wsConn{Conn: conn, reader: reader}, nil
+}
+
+func wsAcceptKey(key string) string {
+	h := sha1.New()
+	io.WriteString(h, key)
+	io.WriteString(h, wsMagic)
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// wsConn wraps a post-handshake WebSocket connection so Read/Write operate
+// on the concatenated payloads of binary/text frames rather than raw
+// WebSocket frames, letting the rest of sipnet treat it as a plain byte
+// stream.
+type wsConn struct {
+	net.Conn
+	reader  *bufio.Reader
+	pending []byte
+}
+
+func (c *wsConn) Read(p []byte) (int, error) {
+	for len(c.pending) == 0 {
+		payload, err := readWSFrame(c.reader)
+		if err != nil {
+			return 0, err
+		}
+		c.pending = payload
+	}
+
+	n := copy(p, c.pending)
+	c.pending = c.pending[n:]
+	return n, nil
+}
+
+func (c *wsConn) Write(p []byte) (int, error) {
+	if err := writeWSFrame(c.Conn, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// readWSFrame reads a single unmasked-or-masked WebSocket frame and returns
+// its payload. Only the final-fragment text/binary opcodes used by SIP over
+// WS clients are handled; ping/pong frames are consumed and skipped, and a
+// close frame ends the stream with io.EOF.
+func readWSFrame(r *bufio.Reader) ([]byte, error) {
+	for {
+		head := make([]byte, 2)
+		if _, err := io.ReadFull(r, head); err != nil {
+			return nil, err
+		}
+
+		opcode := head[0] & 0x0f
+		masked := head[1]&0x80 != 0
+		length := uint64(head[1] & 0x7f)
+
+		switch length {
+		case 126:
+			ext := make([]byte, 2)
+			if _, err := io.ReadFull(r, ext); err != nil {
+				return nil, err
+			}
+			length = uint64(binary.BigEndian.Uint16(ext))
+		case 127:
+			ext := make([]byte, 8)
+			if _, err := io.ReadFull(r, ext); err != nil {
+				return nil, err
+			}
+			length = binary.BigEndian.Uint64(ext)
+		}
+
+		var maskKey [4]byte
+		if masked {
+			if _, err := io.ReadFull(r, maskKey[:]); err != nil {
+				return nil, err
+			}
+		}
+
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(r, payload); err != nil {
+			return nil, err
+		}
+		if masked {
+			for i := range payload {
+				payload[i] ^= maskKey[i%4]
+			}
+		}
+
+		// opcode 0x8 is close, which ends the stream; 0x9/0xa are
+		// ping/pong: nothing SIP-level to deliver, so loop for the next
+		// frame.
+		if opcode == 0x8 {
+			return nil, io.EOF
+		}
+		if opcode == 0x9 || opcode == 0xa {
+			continue
+		}
+
+		return payload, nil
+	}
+}
+
+// writeWSFrame writes payload as a single unmasked final binary frame.
+// Servers never mask frames per RFC 6455 section 5.1.
+func writeWSFrame(w io.Writer, payload []byte) error {
+	var head []byte
+	length := len(payload)
+
+	switch {
+	case length <= 125:
+		head = []byte{0x82, byte(length)}
+	case length <= 0xffff:
+		head = make([]byte, 4)
+		head[0] = 0x82
+		head[1] = 126
+		binary.BigEndian.PutUint16(head[2:], uint16(length))
+	default:
+		head = make([]byte, 10)
+		head[0] = 0x82
+		head[1] = 127
+		binary.BigEndian.PutUint64(head[2:], uint64(length))
+	}
+
+	if _, err := w.Write(head); err != nil {
+		return err
+	}
+	_, err := w.Write(payload)
+	return err
+}